@@ -0,0 +1,157 @@
+package dalle
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// TaskState is the lifecycle state of a persisted generation Record.
+type TaskState string
+
+const (
+	// TaskStateInFlight means the invoice backing the generation has been paid and the task is
+	// still being polled for a result.
+	TaskStateInFlight TaskState = "in_flight"
+	// TaskStateSucceeded means DALL-E finished the task, but the images may not have been
+	// delivered to the user yet.
+	TaskStateSucceeded TaskState = "succeeded"
+	// TaskStateRejected means DALL-E rejected the prompt.
+	TaskStateRejected TaskState = "rejected"
+	// TaskStateFailed means the pipeline gave up on the task for any other reason (transport
+	// error, expired context, canceled by an admin).
+	TaskStateFailed TaskState = "failed"
+	// TaskStateDeliveredUnsettled means the images have already been sent to the user, but
+	// SettleHoldInvoice failed, so the hold invoice has not actually been settled yet. The
+	// record is deliberately kept (not MarkDelivered) so a resume pass retries the settle
+	// instead of the bot silently eating the cost of the generation, and the admin
+	// /generations command can still surface it for operator triage.
+	TaskStateDeliveredUnsettled TaskState = "delivered_unsettled"
+)
+
+// Record is the persisted state of a single DALL-E generation, from the moment its hold invoice
+// is paid until its images have been delivered or the sender has been made whole. It lets the
+// bot resume or refund generations left in flight by a restart, the same way LND's channeldb
+// control tower tracks in-flight payments across a node restart.
+type Record struct {
+	TaskID      string    `json:"task_id"`
+	TelegramID  int64     `json:"telegram_id"`
+	InvoiceHash string    `json:"invoice_hash"`
+	Preimage    string    `json:"preimage"`
+	Prompt      string    `json:"prompt"`
+	CreatedAt   time.Time `json:"created_at"`
+	State       TaskState `json:"state"`
+	Delivered   bool      `json:"delivered"`
+}
+
+const recordKeyPrefix = "dalle:generation:"
+
+func recordKey(taskID string) string {
+	return recordKeyPrefix + taskID
+}
+
+// ControlTower durably tracks in-flight DALL-E generations in a Bunt database so a bot restart
+// (deploy, crash, OOM) never silently loses a paid-for generation: a Record moves from
+// TaskStateInFlight to a final state and is only deleted once it has been marked Delivered.
+type ControlTower struct {
+	db *buntdb.DB
+}
+
+// NewControlTower opens (or creates) the Bunt database at path that backs the control tower.
+func NewControlTower(path string) (*ControlTower, error) {
+	db, err := buntdb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ControlTower{db: db}, nil
+}
+
+// RegisterTask persists a new Record in the TaskStateInFlight state for record.TaskID.
+func (c *ControlTower) RegisterTask(record Record) error {
+	record.State = TaskStateInFlight
+	record.Delivered = false
+	return c.save(record)
+}
+
+// SetState transitions the Record for taskID to state.
+func (c *ControlTower) SetState(taskID string, state TaskState) error {
+	record, err := c.Get(taskID)
+	if err != nil {
+		return err
+	}
+	record.State = state
+	return c.save(record)
+}
+
+// MarkDelivered removes the Record for taskID once its images have reached the user, so a
+// resumed scan can never deliver the same generation twice.
+func (c *ControlTower) MarkDelivered(taskID string) error {
+	return c.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(recordKey(taskID))
+		if err != nil && err != buntdb.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// Get returns the persisted Record for taskID.
+func (c *ControlTower) Get(taskID string) (Record, error) {
+	var record Record
+	err := c.db.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(recordKey(taskID))
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(val), &record)
+	})
+	if err != nil {
+		return Record{}, fmt.Errorf("no generation record for task %s: %w", taskID, err)
+	}
+	return record, nil
+}
+
+// Pending returns every Record that still needs attention after a restart: anything not yet
+// delivered and not already in a terminal-failed state. This includes TaskStateDeliveredUnsettled,
+// so a generation whose images were sent but whose hold invoice failed to settle gets its settle
+// retried rather than being lost.
+func (c *ControlTower) Pending() ([]Record, error) {
+	return c.scan(func(r Record) bool {
+		return !r.Delivered && r.State != TaskStateRejected && r.State != TaskStateFailed
+	})
+}
+
+// All returns every persisted Record, for the admin /generations command.
+func (c *ControlTower) All() ([]Record, error) {
+	return c.scan(func(Record) bool { return true })
+}
+
+func (c *ControlTower) scan(match func(Record) bool) ([]Record, error) {
+	var records []Record
+	err := c.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(recordKeyPrefix+"*", func(key, value string) bool {
+			var record Record
+			if err := json.Unmarshal([]byte(value), &record); err != nil {
+				return true
+			}
+			if match(record) {
+				records = append(records, record)
+			}
+			return true
+		})
+	})
+	return records, err
+}
+
+func (c *ControlTower) save(record Record) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(recordKey(record.TaskID), string(payload), nil)
+		return err
+	})
+}
@@ -0,0 +1,92 @@
+package dalle
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestControlTower(t *testing.T) *ControlTower {
+	t.Helper()
+	ct, err := NewControlTower(filepath.Join(t.TempDir(), "dalle.db"))
+	assert.NoError(t, err)
+	return ct
+}
+
+func TestControlTowerRegisterAndGet(t *testing.T) {
+	ct := newTestControlTower(t)
+
+	record := Record{
+		TaskID:      "task-1",
+		TelegramID:  42,
+		InvoiceHash: "hash-1",
+		Preimage:    "preimage-1",
+		Prompt:      "a cat",
+		CreatedAt:   time.Unix(0, 0),
+	}
+	assert.NoError(t, ct.RegisterTask(record))
+
+	got, err := ct.Get("task-1")
+	assert.NoError(t, err)
+	assert.Equal(t, TaskStateInFlight, got.State)
+	assert.False(t, got.Delivered)
+	assert.Equal(t, record.Prompt, got.Prompt)
+}
+
+func TestControlTowerPendingExcludesTerminalAndDelivered(t *testing.T) {
+	ct := newTestControlTower(t)
+
+	assert.NoError(t, ct.RegisterTask(Record{TaskID: "in-flight"}))
+	assert.NoError(t, ct.RegisterTask(Record{TaskID: "failed"}))
+	assert.NoError(t, ct.SetState("failed", TaskStateFailed))
+	assert.NoError(t, ct.RegisterTask(Record{TaskID: "rejected"}))
+	assert.NoError(t, ct.SetState("rejected", TaskStateRejected))
+	assert.NoError(t, ct.RegisterTask(Record{TaskID: "delivered"}))
+	assert.NoError(t, ct.SetState("delivered", TaskStateSucceeded))
+	assert.NoError(t, ct.MarkDelivered("delivered"))
+
+	pending, err := ct.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "in-flight", pending[0].TaskID)
+}
+
+func TestControlTowerPendingIncludesDeliveredUnsettled(t *testing.T) {
+	ct := newTestControlTower(t)
+
+	assert.NoError(t, ct.RegisterTask(Record{TaskID: "unsettled"}))
+	assert.NoError(t, ct.SetState("unsettled", TaskStateDeliveredUnsettled))
+
+	pending, err := ct.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, TaskStateDeliveredUnsettled, pending[0].State)
+}
+
+func TestControlTowerMarkDeliveredRemovesRecord(t *testing.T) {
+	ct := newTestControlTower(t)
+
+	assert.NoError(t, ct.RegisterTask(Record{TaskID: "task-1"}))
+	assert.NoError(t, ct.MarkDelivered("task-1"))
+
+	_, err := ct.Get("task-1")
+	assert.Error(t, err)
+
+	// deleting an already-delivered task again must stay a no-op, since a resumed scan and
+	// the live delivery path can race to call MarkDelivered for the same task.
+	assert.NoError(t, ct.MarkDelivered("task-1"))
+}
+
+func TestControlTowerAllReturnsEveryRecord(t *testing.T) {
+	ct := newTestControlTower(t)
+
+	assert.NoError(t, ct.RegisterTask(Record{TaskID: "task-1"}))
+	assert.NoError(t, ct.RegisterTask(Record{TaskID: "task-2"}))
+	assert.NoError(t, ct.SetState("task-2", TaskStateFailed))
+
+	all, err := ct.All()
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+}
@@ -0,0 +1,22 @@
+package dalle
+
+// StatusFailed and StatusCanceled round out the terminal states alongside the existing
+// StatusSucceeded and StatusRejected, so IsFinal treats a task reported as failed or canceled as
+// final. WaitForTask does not produce either status itself: an exhausted transient-error budget
+// or a canceled context comes back from it as an error.
+const (
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+)
+
+// IsFinal reports whether t has reached one of DALL-E generation's terminal states. Once true,
+// GetTask will never again return a different status for the same task, mirroring the
+// settled/canceled final states of LND's invoice subsystem.
+func (t *Task) IsFinal() bool {
+	switch t.Status {
+	case StatusSucceeded, StatusRejected, StatusFailed, StatusCanceled:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,25 @@
+package dalle
+
+import "testing"
+
+func TestTaskIsFinal(t *testing.T) {
+	cases := []struct {
+		status Status
+		final  bool
+	}{
+		{StatusSucceeded, true},
+		{StatusRejected, true},
+		{StatusFailed, true},
+		{StatusCanceled, true},
+		{Status("in_progress"), false},
+		{Status("pending"), false},
+		{Status(""), false},
+	}
+
+	for _, c := range cases {
+		task := &Task{Status: c.status}
+		if got := task.IsFinal(); got != c.final {
+			t.Errorf("Task{Status: %q}.IsFinal() = %v, want %v", c.status, got, c.final)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package dalle
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// WaitPolicy controls how WaitForTask paces its polling and how much transient-error budget it
+// tolerates before giving up.
+type WaitPolicy struct {
+	// InitialBackoff is the delay before the first retry; it doubles after every attempt up to
+	// MaxBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff.
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of consecutive GetTask errors WaitForTask tolerates as
+	// transient before giving up and returning the error.
+	MaxAttempts int
+}
+
+// DefaultWaitPolicy backs off from 2s to a 20s cap and tolerates 5 consecutive transient errors
+// before giving up, replacing the previous flat 3-second poll.
+var DefaultWaitPolicy = WaitPolicy{
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     20 * time.Second,
+	MaxAttempts:    5,
+}
+
+// OnPoll, if set, is called after every GetTask attempt so a caller can surface progress, e.g.
+// editing a "still working..." message. task is nil when err is non-nil.
+type OnPoll func(task *Task, err error)
+
+// WaitForTask polls client.GetTask(taskID) until it reaches a final state (Task.IsFinal),
+// backing off exponentially with jitter between attempts instead of a flat sleep. A GetTask
+// error is treated as transient and retried, up to policy.MaxAttempts consecutive failures,
+// before WaitForTask gives up and returns the error so the caller can refund the sender instead
+// of waiting forever on an API that is down. Canceling ctx returns ctx.Err() immediately, so a
+// shutdown or admin cancel triggers a deterministic refund rather than hanging.
+func WaitForTask(ctx context.Context, client Client, taskID string, policy WaitPolicy, onPoll OnPoll) (*Task, error) {
+	backoff := policy.InitialBackoff
+	failures := 0
+	for {
+		task, err := client.GetTask(ctx, taskID)
+		if onPoll != nil {
+			onPoll(task, err)
+		}
+
+		if err != nil {
+			failures++
+			if failures > policy.MaxAttempts {
+				return nil, fmt.Errorf("dalle: giving up on task %s after %d transient errors: %w", taskID, failures, err)
+			}
+		} else {
+			failures = 0
+			if task.IsFinal() {
+				return task, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(jitter(backoff)):
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// jitter returns a duration in [d/2, d], so concurrent waiters polling the same struggling
+// upstream don't all retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := int64(d) / 2
+	return time.Duration(half + rand.Int63n(half+1))
+}
@@ -0,0 +1,120 @@
+package dalle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient replays a scripted sequence of GetTask results, one per call, so tests can drive
+// WaitForTask through transient errors and final states without a real DALL-E API.
+type fakeClient struct {
+	tasks []*Task
+	errs  []error
+	calls int
+}
+
+func (f *fakeClient) Generate(ctx context.Context, prompt string) (*Task, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeClient) Download(ctx context.Context, id string) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeClient) GetTask(ctx context.Context, taskID string) (*Task, error) {
+	i := f.calls
+	f.calls++
+	if i >= len(f.tasks) {
+		i = len(f.tasks) - 1
+	}
+	return f.tasks[i], f.errs[i]
+}
+
+// fastPolicy mirrors DefaultWaitPolicy's shape but with millisecond-scale backoff (1ms to 4ms) so
+// the tests don't spend real wall-clock time waiting.
+var fastPolicy = WaitPolicy{
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     4 * time.Millisecond,
+	MaxAttempts:    3,
+}
+
+func TestWaitForTaskSucceedsAfterTransientErrors(t *testing.T) {
+	client := &fakeClient{
+		tasks: []*Task{nil, nil, {ID: "task-1", Status: StatusSucceeded}},
+		errs:  []error{errors.New("timeout"), errors.New("timeout"), nil},
+	}
+
+	var polled []struct {
+		task *Task
+		err  error
+	}
+	task, err := WaitForTask(context.Background(), client, "task-1", fastPolicy, func(task *Task, err error) {
+		// the onPoll callback must be able to see a transient error without dereferencing a
+		// nil task: this is the exact shape that regressed when the closure shadowed the
+		// outer task variable (see dalle_generate.go's generateDalleImages).
+		polled = append(polled, struct {
+			task *Task
+			err  error
+		}{task, err})
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.Equal(t, StatusSucceeded, task.Status)
+	assert.Len(t, polled, 3)
+	assert.Nil(t, polled[0].task)
+	assert.Error(t, polled[0].err)
+	assert.Nil(t, polled[1].task)
+	assert.Error(t, polled[1].err)
+	assert.NotNil(t, polled[2].task)
+	assert.NoError(t, polled[2].err)
+}
+
+func TestWaitForTaskGivesUpAfterMaxAttempts(t *testing.T) {
+	failing := errors.New("upstream down")
+	client := &fakeClient{
+		tasks: []*Task{nil, nil, nil, nil, nil},
+		errs:  []error{failing, failing, failing, failing, failing},
+	}
+
+	task, err := WaitForTask(context.Background(), client, "task-1", fastPolicy, nil)
+	assert.Nil(t, task)
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, failing)
+	assert.Equal(t, fastPolicy.MaxAttempts+1, client.calls)
+}
+
+func TestWaitForTaskRetriesUntilFinalState(t *testing.T) {
+	client := &fakeClient{
+		tasks: []*Task{
+			{ID: "task-1", Status: Status("in_progress")},
+			{ID: "task-1", Status: Status("in_progress")},
+			{ID: "task-1", Status: StatusRejected},
+		},
+		errs: []error{nil, nil, nil},
+	}
+
+	task, err := WaitForTask(context.Background(), client, "task-1", fastPolicy, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRejected, task.Status)
+	assert.Equal(t, 3, client.calls)
+}
+
+func TestWaitForTaskReturnsContextError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := &fakeClient{
+		tasks: []*Task{{ID: "task-1", Status: Status("in_progress")}},
+		errs:  []error{nil},
+	}
+
+	task, err := WaitForTask(ctx, client, "task-1", fastPolicy, nil)
+	assert.Nil(t, task)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/dalle"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/lightningtipbot/telebot.v3"
+)
+
+// dalleControlTower durably tracks in-flight DALL-E generations across bot restarts. It is nil
+// until InitDalleControlTower has run; every caller that might fire before startup finishes
+// guards its use behind a nil check.
+var dalleControlTower *dalle.ControlTower
+
+// InitDalleControlTower opens the generation control tower's Bunt database at path and resumes
+// every pending record left over from before the last restart: a task the pipeline never
+// delivered is either delivered now or refunded, so a deploy, crash, or OOM mid-generation never
+// silently costs the sender their payment.
+func (bot *TipBot) InitDalleControlTower(path string) error {
+	ct, err := dalle.NewControlTower(path)
+	if err != nil {
+		return err
+	}
+	dalleControlTower = ct
+	bot.Telegram.Handle("/generations", bot.generationsHandler)
+	go bot.resumeDalleGenerations()
+	return nil
+}
+
+func (bot *TipBot) resumeDalleGenerations() {
+	records, err := dalleControlTower.Pending()
+	if err != nil {
+		log.Errorf("[resumeDalleGenerations] %v", err.Error())
+		return
+	}
+	for _, record := range records {
+		bot.resumeDalleGeneration(record)
+	}
+}
+
+// resumeDalleGeneration picks a single pending record back up after a restart. It shares
+// deliverDalleImages with the live payment path, so a task can never be delivered twice: once
+// delivered, MarkDelivered removes the record and a later scan will not see it again.
+func (bot *TipBot) resumeDalleGeneration(record dalle.Record) {
+	user, err := GetUser(&tb.User{ID: record.TelegramID}, *bot)
+	if err != nil || user.Wallet == nil {
+		log.Errorf("[resumeDalleGeneration] could not load user for task %s: %v", record.TaskID, err)
+		return
+	}
+	// the hold invoice lives on the bot's own wallet, so settling/canceling it must
+	// authenticate with the bot's wallet, not the sender's
+	me, err := GetUser(bot.Telegram.Me, *bot)
+	if err != nil || me.Wallet == nil {
+		log.Errorf("[resumeDalleGeneration] could not load bot wallet for task %s: %v", record.TaskID, err)
+		return
+	}
+
+	if record.State == dalle.TaskStateDeliveredUnsettled {
+		// the images were already sent before the restart; all that's left is collecting
+		// payment, so retry the settle instead of re-running the whole generation
+		bot.settleDalleTask(me, record.Preimage, record.TaskID)
+		return
+	}
+
+	dalleClient, err := dalle.NewHTTPClient(internal.Configuration.Generate.DalleKey)
+	if err != nil {
+		log.Errorf("[resumeDalleGeneration] %v", err.Error())
+		bot.failDalleTask(me, record.InvoiceHash, record.TaskID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	defer cancel()
+	t, err := dalle.WaitForTask(ctx, dalleClient, record.TaskID, dalle.DefaultWaitPolicy, nil)
+	if err != nil {
+		log.Errorf("[resumeDalleGeneration] %v", err.Error())
+		bot.failDalleTask(me, record.InvoiceHash, record.TaskID)
+		return
+	}
+
+	switch t.Status {
+	case dalle.StatusSucceeded:
+		bot.deliverDalleImages(ctx, dalleClient, t, me, user, record.InvoiceHash, record.Preimage)
+	case dalle.StatusRejected:
+		bot.rejectDalleTask(me, record.InvoiceHash, record.TaskID)
+	default:
+		bot.failDalleTask(me, record.InvoiceHash, record.TaskID)
+	}
+}
+
+// generationsHandler is the admin command /generations: it lists every DALL-E generation record
+// the control tower still knows about, for operator triage of stuck or failed tasks. It is
+// registered from InitDalleControlTower and gated behind the admin allowlist, since the records
+// it exposes include every user's Telegram ID and prompt.
+func (bot *TipBot) generationsHandler(c tb.Context) error {
+	sender := c.Sender()
+	if sender == nil || !isAdminID(sender.ID) {
+		return nil
+	}
+
+	if dalleControlTower == nil {
+		bot.trySendMessage(sender, "DALL-E control tower is not initialized.")
+		return nil
+	}
+	records, err := dalleControlTower.All()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		bot.trySendMessage(sender, "No DALL-E generation records.")
+		return nil
+	}
+
+	var sb strings.Builder
+	for _, record := range records {
+		sb.WriteString(fmt.Sprintf("`%s` user=%d state=%s delivered=%t created=%s\n",
+			record.TaskID, record.TelegramID, record.State, record.Delivered, record.CreatedAt.Format(time.RFC3339)))
+	}
+	bot.trySendMessage(sender, sb.String())
+	return nil
+}
+
+// isAdminID reports whether telegramID belongs to one of the bot's configured admins.
+func isAdminID(telegramID int64) bool {
+	for _, id := range internal.Configuration.Telegram.AdminIds {
+		if id == telegramID {
+			return true
+		}
+	}
+	return false
+}
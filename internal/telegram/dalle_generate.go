@@ -0,0 +1,337 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/dalle"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/telegram/intercept"
+	log "github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+	tb "gopkg.in/lightningtipbot/telebot.v3"
+)
+
+// dalleCallbackData is the payload stashed in the hold invoice's CallbackData field. It carries
+// everything generateDalleImages needs to resume the generation once the invoice is paid: the
+// prompt to send to DALL-E, and the hash/preimage pair needed to settle or cancel the sender's
+// held HTLC once the pipeline reaches a final state.
+type dalleCallbackData struct {
+	Prompt   string `json:"prompt"`
+	Hash     string `json:"hash"`
+	Preimage string `json:"preimage"`
+}
+
+// generateImages is called when the user enters /generate or /generate <prompt>
+// asks the user for a prompt if not given
+func (bot *TipBot) generateImages(ctx intercept.Context) (intercept.Context, error) {
+	bot.anyTextHandler(ctx)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return ctx, fmt.Errorf("user has no wallet")
+	}
+
+	if len(strings.Split(ctx.Message().Text, " ")) < 2 {
+		// We need to save the pay state in the user state so we can load the payment in the next handler
+		SetUserState(user, bot, lnbits.UserEnterDallePrompt, "")
+		bot.trySendMessage(ctx.Message().Sender, "⌨️ Enter image prompt.", tb.ForceReply)
+		return ctx, nil
+	}
+	// write the prompt into the command and call confirm
+	m := ctx.Message()
+	m.Text = GetMemoFromCommand(m.Text, 1)
+	return bot.confirmGenerateImages(ctx)
+}
+
+// confirmGenerateImages is called when the user has entered a prompt through /generate <prompt>
+// or because he answered to the request to enter it in generateImages()
+// confirmGenerateImages creates a hold invoice for a random preimage: the sender's HTLC is
+// accepted but not settled until generateDalleImages has delivered the images, so a failed
+// generation is made whole by canceling the invoice instead of sending a compensating payment.
+func (bot *TipBot) confirmGenerateImages(ctx intercept.Context) (intercept.Context, error) {
+	user := LoadUser(ctx)
+
+	ResetUserState(user, bot)
+	m := ctx.Message()
+	prompt := m.Text
+	if len(prompt) == 0 {
+		return ctx, fmt.Errorf("prompt not given")
+	}
+
+	if user.Wallet == nil {
+		return ctx, fmt.Errorf("user has no wallet")
+	}
+	me, err := GetUser(bot.Telegram.Me, *bot)
+	if err != nil {
+		return ctx, err
+	}
+
+	preimage := make([]byte, 32)
+	if _, err = rand.Read(preimage); err != nil {
+		return ctx, err
+	}
+	hash := sha256.Sum256(preimage)
+	callbackData, err := json.Marshal(dalleCallbackData{
+		Prompt:   prompt,
+		Hash:     hex.EncodeToString(hash[:]),
+		Preimage: hex.EncodeToString(preimage),
+	})
+	if err != nil {
+		return ctx, err
+	}
+
+	invoice, err := bot.createHoldInvoiceWithEvent(ctx, me, hex.EncodeToString(hash[:]), internal.Configuration.Generate.DallePrice, fmt.Sprintf("DALLE2 %s", GetUserStr(user.Telegram)), InvoiceCallbackGenerateDalle, string(callbackData))
+	if err != nil {
+		return ctx, err
+	}
+
+	balance, err := bot.GetUserBalance(user)
+	if err != nil {
+		errmsg := fmt.Sprintf("[inlineReceive] Error: Could not get user balance: %s", err.Error())
+		log.Warnln(errmsg)
+	}
+
+	bot.trySendMessage(ctx.Message().Sender, Translate(ctx, "generateDallePayInvoiceMessage"))
+
+	// invoke internal pay if enough balance
+	if balance >= internal.Configuration.Generate.DallePrice {
+		m.Text = fmt.Sprintf("/pay %s", invoice.PaymentRequest)
+		return bot.payHandler(ctx)
+	}
+
+	// create qr code
+	qr, err := qrcode.Encode(invoice.PaymentRequest, qrcode.Medium, 256)
+	if err != nil {
+		bot.tryEditMessage(invoice.Message, Translate(ctx, "errorTryLaterMessage"))
+		return ctx, err
+	}
+
+	// send the invoice data to user
+	msg := bot.trySendMessage(ctx.Message().Sender, &tb.Photo{File: tb.File{FileReader: bytes.NewReader(qr)}, Caption: fmt.Sprintf("`%s`", invoice.PaymentRequest)})
+	invoice.InvoiceMessage = msg
+	runtime.IgnoreError(bot.Bunt.Set(invoice))
+	return ctx, nil
+}
+
+// createHoldInvoiceWithEvent registers a hold invoice for hash with the bot's own wallet and
+// wires it up to the invoice event machinery the same way createInvoiceWithEvent does for a
+// regular invoice, except the resulting HTLC is only accepted, not settled, until the invoice
+// is explicitly settled or canceled.
+func (bot *TipBot) createHoldInvoiceWithEvent(ctx intercept.Context, me *lnbits.User, hash string, amount int64, memo string, callback string, callbackData string) (*lnbits.Invoice, error) {
+	invoice, err := me.Wallet.HoldInvoice(lnbits.HoldInvoiceParams{
+		Out:     false,
+		Amount:  amount,
+		Hash:    hash,
+		Memo:    memo,
+		Webhook: internal.Configuration.Lnbits.WebhookServer,
+	}, bot.Client)
+	if err != nil {
+		return nil, err
+	}
+	invoice.Payer = LoadUser(ctx)
+	invoice.Callback = callback
+	invoice.CallbackData = callbackData
+	runtime.IgnoreError(bot.Bunt.Set(invoice))
+	return invoice, nil
+}
+
+// generateDalleImages is called by the invoice event once the sender's HTLC has been accepted.
+// The hold invoice stays unsettled for the whole generation: only once the images have been
+// downloaded and delivered is the preimage revealed to settle it. Once the bot's wallet and the
+// callback data are loaded, any failure of the DALL-E pipeline (client setup, task creation,
+// polling, rejection, download) cancels the invoice instead, so the sender is made whole
+// automatically. A failure to load the bot's wallet or the callback data returns without
+// canceling, and a failure to persist the task record is only logged.
+func (bot *TipBot) generateDalleImages(event Event) {
+	invoiceEvent := event.(*InvoiceEvent)
+	user := invoiceEvent.Payer
+	if user == nil || user.Wallet == nil {
+		log.Errorf("[generateDalleImages] invalid user")
+		return
+	}
+	// the hold invoice was created on the bot's own wallet (me.Wallet.HoldInvoice in
+	// createHoldInvoiceWithEvent), so settling or canceling it must authenticate with the
+	// bot's wallet, not the payer's
+	me, err := GetUser(bot.Telegram.Me, *bot)
+	if err != nil || me.Wallet == nil {
+		log.Errorf("[generateDalleImages] could not load bot wallet: %v", err)
+		return
+	}
+
+	var data dalleCallbackData
+	if err = json.Unmarshal([]byte(invoiceEvent.CallbackData), &data); err != nil {
+		log.Errorf("[generateDalleImages] invalid callback data: %v", err)
+		return
+	}
+
+	statusMessage := bot.trySendMessage(user.Telegram, "Your images are being generated. Please wait...")
+
+	// create the client with the bearer token api key
+	dalleClient, err := dalle.NewHTTPClient(internal.Configuration.Generate.DalleKey)
+	// handle err
+	if err != nil {
+		log.Errorf("[NewHTTPClient] %v", err.Error())
+		bot.dalleRefundUser(me, data.Hash)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	defer cancel()
+	// generate a task to create an image with a prompt
+	task, err := dalleClient.Generate(ctx, data.Prompt)
+	if err != nil {
+		log.Errorf("[Generate] %v", err.Error())
+		bot.dalleRefundUser(me, data.Hash)
+		return
+	}
+
+	// persist the task so a restart before delivery can resume or refund it instead of
+	// silently losing it
+	if dalleControlTower != nil {
+		if err = dalleControlTower.RegisterTask(dalle.Record{
+			TaskID:      task.ID,
+			TelegramID:  user.Telegram.ID,
+			InvoiceHash: data.Hash,
+			Preimage:    data.Preimage,
+			Prompt:      data.Prompt,
+			CreatedAt:   time.Now(),
+		}); err != nil {
+			log.Errorf("[RegisterTask] %v", err.Error())
+		}
+	}
+
+	// wait for the task to reach a final state, backing off exponentially instead of a flat
+	// 3s sleep, and let the sender know we're still working on long generations
+	t, err := dalle.WaitForTask(ctx, dalleClient, task.ID, dalle.DefaultWaitPolicy, func(polled *dalle.Task, pollErr error) {
+		if pollErr != nil {
+			log.Debugf("[DALLE] transient error polling task %s: %v", task.ID, pollErr)
+			return
+		}
+		bot.tryEditMessage(statusMessage, fmt.Sprintf("Still working on your images... (%s)", polled.Status))
+	})
+	if err != nil {
+		log.Errorf("[WaitForTask] %v", err.Error())
+		bot.failDalleTask(me, data.Hash, task.ID)
+		return
+	}
+	if t.Status == dalle.StatusRejected {
+		log.Errorf("[DALLE] rejected: %s", t.ID)
+		bot.rejectDalleTask(me, data.Hash, task.ID)
+		return
+	} else if t.Status != dalle.StatusSucceeded {
+		log.Errorf("[DALLE] task %s ended in non-final-success state %s", t.ID, t.Status)
+		bot.failDalleTask(me, data.Hash, task.ID)
+		return
+	}
+	fmt.Printf("[DALLE] task succeeded for user %s", GetUserStr(user.Telegram))
+
+	bot.deliverDalleImages(ctx, dalleClient, t, me, user, data.Hash, data.Preimage)
+}
+
+// deliverDalleImages downloads and sends every generated image, then settles the hold invoice
+// and marks the control tower record delivered. This is the single delivery path shared by a
+// fresh generation and by resumeDalleGeneration after a restart, so a task is never delivered
+// twice: once MarkDelivered succeeds the record is gone and a later scan will not see it again.
+// me is the bot's own account, whose wallet created the hold invoice and is the one that must
+// settle it; user is the sender the images are delivered to.
+func (bot *TipBot) deliverDalleImages(ctx context.Context, dalleClient dalle.Client, t *dalle.Task, me, user *lnbits.User, hash, preimage string) {
+	for _, image := range t.Generations.Data {
+		if err := bot.downloadAndSendImages(ctx, dalleClient, image, user); err != nil {
+			log.Errorf("[downloadAndSendImages] %v", err.Error())
+			bot.failDalleTask(me, hash, t.ID)
+			return
+		}
+	}
+
+	bot.settleDalleTask(me, preimage, t.ID)
+}
+
+// settleDalleTask reveals preimage to settle the hold invoice for taskID once its images have
+// already been delivered. The images are out the door by this point, so canceling is no longer an
+// option if this fails; a settle failure must not be treated as success, or the bot hands out the
+// images and never collects payment once the still-held invoice auto-cancels back to the sender at
+// its LN-level expiry. So on failure the record is left as TaskStateDeliveredUnsettled instead of
+// MarkDelivered, which keeps it visible to resumeDalleGenerations and the admin /generations
+// command so the settle gets retried instead of silently disappearing.
+func (bot *TipBot) settleDalleTask(me *lnbits.User, preimage, taskID string) {
+	if err := me.Wallet.SettleHoldInvoice(preimage, bot.Client); err != nil {
+		log.Errorf("[SettleHoldInvoice] task %s: %v", taskID, err.Error())
+		if dalleControlTower != nil {
+			runtime.IgnoreError(dalleControlTower.SetState(taskID, dalle.TaskStateDeliveredUnsettled))
+		}
+		return
+	}
+	if dalleControlTower != nil {
+		runtime.IgnoreError(dalleControlTower.MarkDelivered(taskID))
+	}
+}
+
+// downloadAndSendImages will download dalle images and send them to user.
+func (bot *TipBot) downloadAndSendImages(ctx context.Context, dalleClient dalle.Client, data dalle.GenerationData, user *lnbits.User) error {
+	reader, err := dalleClient.Download(ctx, data.ID)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	image := "data/dalle/" + data.ID + ".png"
+	file, err := os.Create(image)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(image, 0, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bot.trySendMessage(user.Telegram, &tb.Photo{File: tb.File{FileReader: f}})
+	return nil
+}
+
+// dalleRefundUser cancels the held HTLC for hash using the bot's own wallet me — the one that
+// created the hold invoice via me.Wallet.HoldInvoice — so the sender is made whole automatically,
+// without a second, compensating on-chain/off-chain payment that could itself fail.
+func (bot *TipBot) dalleRefundUser(me *lnbits.User, hash string) error {
+	if me.Wallet == nil {
+		return fmt.Errorf("bot has no wallet")
+	}
+	if err := me.Wallet.CancelHoldInvoice(hash, bot.Client); err != nil {
+		log.Errorln(err)
+		return err
+	}
+	return nil
+}
+
+// failDalleTask cancels the sender's HTLC (via the bot's own wallet me) and marks the persisted
+// record Failed so a resumed scan does not keep retrying a task the pipeline has already given
+// up on.
+func (bot *TipBot) failDalleTask(me *lnbits.User, hash, taskID string) {
+	bot.dalleRefundUser(me, hash)
+	if dalleControlTower != nil {
+		runtime.IgnoreError(dalleControlTower.SetState(taskID, dalle.TaskStateFailed))
+	}
+}
+
+// rejectDalleTask cancels the sender's HTLC (via the bot's own wallet me) and marks the
+// persisted record Rejected.
+func (bot *TipBot) rejectDalleTask(me *lnbits.User, hash, taskID string) {
+	bot.dalleRefundUser(me, hash)
+	if dalleControlTower != nil {
+		runtime.IgnoreError(dalleControlTower.SetState(taskID, dalle.TaskStateRejected))
+	}
+}